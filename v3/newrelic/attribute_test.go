@@ -0,0 +1,82 @@
+package newrelic
+
+import (
+	"bytes"
+	"testing"
+
+	v1 "github.com/newrelic/go-agent/v3/internal/com_newrelic_trace_v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+)
+
+// fakeAttributeValue stands in for the internal.SpanEvent attribute value
+// types: it writes itself as JSON like the real ones do, and additionally
+// implements spanAttributeValuer so mtbAttributeValue/otlpAttributeValue can
+// be exercised against every typed branch without depending on the
+// concrete internal package type.
+type fakeAttributeValue struct {
+	value interface{}
+	json  string
+}
+
+func (f fakeAttributeValue) Value() interface{} { return f.value }
+
+func (f fakeAttributeValue) WriteJSON(buf *bytes.Buffer) {
+	buf.WriteString(f.json)
+}
+
+// fakeStringOnlyValue implements only jsonWriter, mirroring an attribute
+// value type that doesn't expose its original Go type, so dispatch must
+// fall back to the stringified JSON form.
+type fakeStringOnlyValue struct {
+	json string
+}
+
+func (f fakeStringOnlyValue) WriteJSON(buf *bytes.Buffer) {
+	buf.WriteString(f.json)
+}
+
+func TestMtbAttributeValueTypedDispatch(t *testing.T) {
+	testcases := []struct {
+		name string
+		in   jsonWriter
+		want *v1.AttributeValue
+	}{
+		{"bool", fakeAttributeValue{value: true, json: "true"}, mtbBool(true)},
+		{"int64", fakeAttributeValue{value: int64(7), json: "7"}, mtbInt(7)},
+		{"float64", fakeAttributeValue{value: 3.5, json: "3.5"}, mtbDouble(3.5)},
+		{"string", fakeAttributeValue{value: "hi", json: `"hi"`}, mtbString("hi")},
+		{"falls back to JSON", fakeStringOnlyValue{json: `"hi"`}, mtbString("hi")},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := mtbAttributeValue(tc.in)
+			if got.String() != tc.want.String() {
+				t.Errorf("mtbAttributeValue(%v) = %v, want %v", tc.in, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestOtlpAttributeValueTypedDispatch(t *testing.T) {
+	testcases := []struct {
+		name string
+		in   jsonWriter
+		want *commonpb.AnyValue
+	}{
+		{"bool", fakeAttributeValue{value: true, json: "true"}, &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: true}}},
+		{"int64", fakeAttributeValue{value: int64(7), json: "7"}, &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: 7}}},
+		{"float64", fakeAttributeValue{value: 3.5, json: "3.5"}, &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: 3.5}}},
+		{"string", fakeAttributeValue{value: "hi", json: `"hi"`}, &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "hi"}}},
+		{"falls back to JSON", fakeStringOnlyValue{json: `"hi"`}, &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "hi"}}},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := otlpAttributeValue(tc.in)
+			if got.String() != tc.want.String() {
+				t.Errorf("otlpAttributeValue(%v) = %v, want %v", tc.in, got, tc.want)
+			}
+		})
+	}
+}
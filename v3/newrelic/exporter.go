@@ -0,0 +1,82 @@
+package newrelic
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/newrelic/go-agent/v3/internal"
+)
+
+// SpanExporter is the interface satisfied by every span destination the
+// agent can ship to. traceBox (New Relic's trace observer) and otlpExporter
+// (any OTLP/gRPC backend) both implement it.
+//
+// TODO(tiaanl/go-agent#chunk0-3): accept a SpanExporter through a
+// Config.Exporter field once newrelic.Config exists in this package, so
+// users can plug in their own implementation. Until then, nothing in this
+// package constructs a Config or routes spans to an exporter; traceBox and
+// otlpExporter are reachable only by calling newTraceBox/newOTLPExporter
+// directly.
+type SpanExporter interface {
+	// ConsumeSpan offers a span to the exporter. It returns false if the
+	// span could not be accepted, e.g. because internal buffering is
+	// saturated.
+	ConsumeSpan(span *internal.SpanEvent) bool
+
+	// Shutdown stops the exporter, giving buffered spans a bounded chance
+	// to be sent in a final batch, and releases its connection(s). It
+	// returns ctx.Err() if ctx is done first.
+	Shutdown(ctx context.Context) error
+
+	// Flush blocks until every span the exporter has accepted has been
+	// sent, ctx is done, or the exporter's own flush timeout elapses; it
+	// returns an error in the latter two cases.
+	Flush(ctx context.Context) error
+}
+
+// Shutdown cancels the trace box's reconnect loop and active connection.
+// Before closing, an active connection collects queued spans for up to
+// traceBoxDrainTimeout into one final batch of at most
+// TraceBoxConfig.BatchSize spans and sends it; spans queued beyond that
+// batch are not sent. It returns once the sender goroutine has exited, or
+// ctx is done first. Shutdown implements SpanExporter.
+//
+// TODO(tiaanl/go-agent#chunk0-4): call this from Application.Shutdown once
+// that type exists in this package. Until then, nothing calls Shutdown on
+// an application's behalf; callers that construct a traceBox directly must
+// call it themselves.
+func (tb *traceBox) Shutdown(ctx context.Context) error {
+	tb.cancel()
+
+	select {
+	case <-tb.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Flush blocks until tb.pending reaches zero, ctx is done, or
+// traceBoxFlushTimeout elapses, whichever comes first. tb.pending counts every span ConsumeSpan has accepted (into
+// the messages channel or the spill queue) that hasn't yet been confirmed
+// sent over the wire, so this also waits out spans sitting in the
+// in-flight send batch inside spawnConnection and spans still on disk, not
+// just the messages/spilled channels. Flush implements SpanExporter.
+func (tb *traceBox) Flush(ctx context.Context) error {
+	deadline := time.After(traceBoxFlushTimeout)
+	ticker := time.NewTicker(5 * time.Millisecond)
+	defer ticker.Stop()
+
+	for 0 < atomic.LoadInt64(&tb.pending) {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline:
+			return fmt.Errorf("trace box flush timed out with spans still queued")
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
@@ -0,0 +1,405 @@
+package newrelic
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/newrelic/go-agent/v3/internal"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+const (
+	// otlpMessageQueueSize bounds the number of spans ConsumeSpan can have
+	// in flight before it starts reporting saturation, mirroring
+	// traceboxMessageQueueSize.
+	otlpMessageQueueSize = 1000
+
+	// defaultOTLPBatchSize is the number of spans gathered into a single
+	// outgoing Export call when OTLPExporterConfig.BatchSize is unset.
+	defaultOTLPBatchSize = 100
+
+	// defaultOTLPBatchTimeout is the maximum time a partial batch is held
+	// before being flushed when OTLPExporterConfig.BatchTimeout is
+	// unset.
+	defaultOTLPBatchTimeout = 50 * time.Millisecond
+
+	// defaultOTLPExportTimeout bounds how long a single Export RPC is
+	// given to complete when OTLPExporterConfig.ExportTimeout is unset.
+	defaultOTLPExportTimeout = 5 * time.Second
+
+	// otlpFlushTimeout bounds how long Flush waits for the queue to
+	// empty out.
+	otlpFlushTimeout = 5 * time.Second
+
+	// otlpDrainTimeout bounds how long the send loop waits, once asked to
+	// stop, to pull one last batch out of the queue before giving up.
+	otlpDrainTimeout = 2 * time.Second
+)
+
+// OTLPExporterConfig controls how spans are batched on their way to the
+// OTLP/gRPC backend.
+type OTLPExporterConfig struct {
+	// BatchSize is the maximum number of spans gathered into a single
+	// outgoing Export call. Defaults to 100 if zero.
+	BatchSize int
+
+	// BatchTimeout is the maximum amount of time a partial batch is held
+	// before being flushed, even if BatchSize has not been reached.
+	// Defaults to 50ms if zero.
+	BatchTimeout time.Duration
+
+	// ExportTimeout bounds how long a single Export RPC is given to
+	// complete before it's abandoned. Defaults to 5s if zero.
+	ExportTimeout time.Duration
+}
+
+func (c OTLPExporterConfig) batchSize() int {
+	if c.BatchSize <= 0 {
+		return defaultOTLPBatchSize
+	}
+	return c.BatchSize
+}
+
+func (c OTLPExporterConfig) batchTimeout() time.Duration {
+	if c.BatchTimeout <= 0 {
+		return defaultOTLPBatchTimeout
+	}
+	return c.BatchTimeout
+}
+
+func (c OTLPExporterConfig) exportTimeout() time.Duration {
+	if c.ExportTimeout <= 0 {
+		return defaultOTLPExportTimeout
+	}
+	return c.ExportTimeout
+}
+
+// otlpExporterStats holds the counters backing OTLPExporterStats. All fields
+// are accessed atomically since they are updated from the send loop and read
+// from arbitrary application goroutines.
+type otlpExporterStats struct {
+	batched int64
+	failed  int64
+}
+
+// OTLPExporterStatsSnapshot is a point-in-time copy of an otlpExporter's
+// counters, as returned by otlpExporter.OTLPExporterStats.
+type OTLPExporterStatsSnapshot struct {
+	// Batched is the number of spans successfully delivered by an Export
+	// RPC.
+	Batched int64
+
+	// Failed is the number of spans whose Export RPC returned an error.
+	// They remain counted against the exporter's pending total, since
+	// they were never confirmed delivered, so Flush won't report success
+	// while they're outstanding.
+	Failed int64
+}
+
+// otlpExporter is a SpanExporter that forwards spans to any OTLP/gRPC
+// compatible backend, as an alternative to traceBox's New Relic trace
+// observer protocol. Spans are batched and sent from a single background
+// goroutine, the way traceBox batches spans onto its own connection,
+// instead of blocking ConsumeSpan on a synchronous per-span Export call.
+type otlpExporter struct {
+	conn     *grpc.ClientConn
+	client   coltracepb.TraceServiceClient
+	config   OTLPExporterConfig
+	messages chan *internal.SpanEvent
+	stats    otlpExporterStats
+	lg       Logger
+
+	// pending is the number of spans accepted by ConsumeSpan but not yet
+	// confirmed sent, polled by Flush. A batch whose Export RPC fails
+	// leaves its spans counted here, since they were never confirmed
+	// delivered.
+	pending int64
+
+	// ctx governs the lifetime of the send loop; cancel is called
+	// exactly once, by Shutdown. done is closed once the send loop has
+	// returned.
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// newOTLPExporter dials endpoint and returns a SpanExporter that translates
+// spans into the OpenTelemetry wire format before batching and sending
+// them.
+func newOTLPExporter(endpoint string, lg Logger, config OTLPExporterConfig, dialOpts ...grpc.DialOption) (*otlpExporter, error) {
+	opts := append([]grpc.DialOption{grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{}))}, dialOpts...)
+
+	conn, err := grpc.Dial(endpoint, opts...)
+	if nil != err {
+		return nil, fmt.Errorf("unable to dial otlp endpoint %s: %v", endpoint, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	e := &otlpExporter{
+		conn:     conn,
+		client:   coltracepb.NewTraceServiceClient(conn),
+		config:   config,
+		messages: make(chan *internal.SpanEvent, otlpMessageQueueSize),
+		lg:       lg,
+		ctx:      ctx,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+
+	go e.sendLoop()
+
+	return e, nil
+}
+
+// OTLPExporterStats returns a snapshot of this otlpExporter's batching
+// counters, for diagnostics and monitoring.
+func (e *otlpExporter) OTLPExporterStats() OTLPExporterStatsSnapshot {
+	return OTLPExporterStatsSnapshot{
+		Batched: atomic.LoadInt64(&e.stats.batched),
+		Failed:  atomic.LoadInt64(&e.stats.failed),
+	}
+}
+
+// ConsumeSpan offers event to the in-memory send queue, returning false
+// without blocking if it's full. ConsumeSpan implements SpanExporter.
+func (e *otlpExporter) ConsumeSpan(event *internal.SpanEvent) bool {
+	select {
+	case e.messages <- event:
+		atomic.AddInt64(&e.pending, 1)
+		return true
+	default:
+		return false
+	}
+}
+
+// sendLoop batches spans off e.messages and flushes them to the OTLP
+// backend, until e.ctx is cancelled.
+func (e *otlpExporter) sendLoop() {
+	defer close(e.done)
+
+	batchSize := e.config.batchSize()
+	batchTimeout := e.config.batchTimeout()
+	batch := make([]*internal.SpanEvent, 0, batchSize)
+
+	timer := time.NewTimer(batchTimeout)
+	defer timer.Stop()
+
+	flush := func() {
+		if 0 == len(batch) {
+			return
+		}
+		if err := e.export(batch); nil != err {
+			e.lg.Error("otlp export error", map[string]interface{}{
+				"err":   err.Error(),
+				"spans": len(batch),
+			})
+			atomic.AddInt64(&e.stats.failed, int64(len(batch)))
+			// Leave these spans counted in e.pending: they were
+			// never confirmed delivered, so Flush should keep
+			// waiting (and eventually time out) rather than
+			// reporting success for a dropped batch.
+			batch = batch[:0]
+			return
+		}
+		atomic.AddInt64(&e.stats.batched, int64(len(batch)))
+		atomic.AddInt64(&e.pending, -int64(len(batch)))
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case <-e.ctx.Done():
+			// Give whatever is still queued a bounded chance to go
+			// out before giving up.
+			drainDeadline := time.After(otlpDrainTimeout)
+		drainLoop:
+			for len(batch) < batchSize {
+				select {
+				case event := <-e.messages:
+					batch = append(batch, event)
+				case <-drainDeadline:
+					break drainLoop
+				}
+			}
+			flush()
+			return
+		case event := <-e.messages:
+			batch = append(batch, event)
+			if len(batch) >= batchSize {
+				flush()
+				if !timer.Stop() {
+					<-timer.C
+				}
+				timer.Reset(batchTimeout)
+			}
+		case <-timer.C:
+			flush()
+			timer.Reset(batchTimeout)
+		}
+	}
+}
+
+// export sends events to the OTLP backend as a single Export RPC, bounded
+// by e.config.exportTimeout, and reports whether the backend accepted them.
+func (e *otlpExporter) export(events []*internal.SpanEvent) error {
+	spans := make([]*tracepb.Span, len(events))
+	for i, event := range events {
+		spans[i] = transformEventToOTLP(event)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.config.exportTimeout())
+	defer cancel()
+
+	_, err := e.client.Export(ctx, &coltracepb.ExportTraceServiceRequest{
+		ResourceSpans: []*tracepb.ResourceSpans{
+			{
+				ScopeSpans: []*tracepb.ScopeSpans{
+					{Spans: spans},
+				},
+			},
+		},
+	})
+	if nil != err {
+		return fmt.Errorf("otlp export rpc failed: %v", err)
+	}
+	return nil
+}
+
+// Shutdown cancels the send loop, which collects queued spans for up to
+// otlpDrainTimeout into one final batch of at most BatchSize spans and
+// exports it; spans queued beyond that batch are not sent. It returns once
+// the send loop has exited, or ctx is done first. The connection is closed
+// unconditionally either way, so it's never leaked even if ctx fires before
+// the send loop finishes draining. Shutdown implements SpanExporter.
+func (e *otlpExporter) Shutdown(ctx context.Context) error {
+	e.cancel()
+	defer e.conn.Close()
+
+	select {
+	case <-e.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Flush blocks until e.pending reaches zero, ctx is done, or
+// otlpFlushTimeout elapses, whichever comes first. Flush implements SpanExporter.
+func (e *otlpExporter) Flush(ctx context.Context) error {
+	deadline := time.After(otlpFlushTimeout)
+	ticker := time.NewTicker(5 * time.Millisecond)
+	defer ticker.Stop()
+
+	for 0 < atomic.LoadInt64(&e.pending) {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline:
+			return fmt.Errorf("otlp exporter flush timed out with spans still queued")
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// otlpSpanID truncates or decodes a New Relic hex ID into the byte length
+// OTLP expects, padding with leading zeros if it's too short.
+func otlpSpanID(id string, size int) []byte {
+	b, err := hex.DecodeString(id)
+	if nil != err || 0 == len(b) {
+		return make([]byte, size)
+	}
+	if len(b) > size {
+		return b[len(b)-size:]
+	}
+	if len(b) < size {
+		padded := make([]byte, size)
+		copy(padded[size-len(b):], b)
+		return padded
+	}
+	return b
+}
+
+// otlpSpanKind maps the span.kind attribute used in New Relic's span model
+// to the closest OpenTelemetry SpanKind. kind takes precedence when set;
+// most spans only carry a category, though, so category is consulted as a
+// fallback rather than collapsing them all to SPAN_KIND_INTERNAL.
+func otlpSpanKind(kind, category string) tracepb.Span_SpanKind {
+	switch strings.ToLower(kind) {
+	case "client":
+		return tracepb.Span_SPAN_KIND_CLIENT
+	case "server":
+		return tracepb.Span_SPAN_KIND_SERVER
+	case "producer":
+		return tracepb.Span_SPAN_KIND_PRODUCER
+	case "consumer":
+		return tracepb.Span_SPAN_KIND_CONSUMER
+	}
+
+	switch strings.ToLower(category) {
+	case "http", "datastore":
+		return tracepb.Span_SPAN_KIND_CLIENT
+	default:
+		return tracepb.Span_SPAN_KIND_INTERNAL
+	}
+}
+
+// otlpAttributeValue converts a span attribute into its typed OTLP
+// AnyValue representation, mirroring the dispatch mtbAttributeValue does for
+// the New Relic trace observer protocol.
+func otlpAttributeValue(val jsonWriter) *commonpb.AnyValue {
+	if valuer, ok := val.(spanAttributeValuer); ok {
+		switch v := valuer.Value().(type) {
+		case bool:
+			return &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: v}}
+		case int64:
+			return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: v}}
+		case float64:
+			return &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: v}}
+		case string:
+			return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v}}
+		}
+	}
+
+	b := bytes.Buffer{}
+	val.WriteJSON(&b)
+	return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: strings.Trim(b.String(), `"`)}}
+}
+
+// transformEventToOTLP translates an internal.SpanEvent into its OTLP
+// wire-format equivalent, mapping IDs, kind, attributes, and timing the way
+// transformEvent does for the New Relic trace observer protocol.
+func transformEventToOTLP(e *internal.SpanEvent) *tracepb.Span {
+	span := &tracepb.Span{
+		TraceId:           otlpSpanID(e.TraceID, 16),
+		SpanId:            otlpSpanID(e.GUID, 8),
+		Name:              e.Name,
+		Kind:              otlpSpanKind(e.Kind, string(e.Category)),
+		StartTimeUnixNano: uint64(e.Timestamp.UnixNano()),
+		EndTimeUnixNano:   uint64(e.Timestamp.Add(e.Duration).UnixNano()),
+	}
+
+	if "" != e.ParentID {
+		span.ParentSpanId = otlpSpanID(e.ParentID, 8)
+	}
+
+	for key, val := range e.Attributes {
+		span.Attributes = append(span.Attributes, &commonpb.KeyValue{
+			Key:   key.String(),
+			Value: otlpAttributeValue(val),
+		})
+	}
+
+	return span
+}
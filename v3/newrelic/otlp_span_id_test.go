@@ -0,0 +1,33 @@
+package newrelic
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestOtlpSpanIDPadsAndTruncates(t *testing.T) {
+	testcases := []struct {
+		name string
+		id   string
+		size int
+		want []byte
+	}{
+		{"empty id is zero-filled", "", 8, make([]byte, 8)},
+		{"invalid hex is zero-filled", "not-hex!", 8, make([]byte, 8)},
+		{"short id is left-padded with zeros", "ab", 4, []byte{0x00, 0x00, 0x00, 0xab}},
+		{"exact length id is passed through", "0123456789abcdef", 8, []byte{0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef}},
+		{"long id is truncated to the trailing bytes", "1122334455667788", 1, []byte{0x88}},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := otlpSpanID(tc.id, tc.size)
+			if !bytes.Equal(got, tc.want) {
+				t.Errorf("otlpSpanID(%q, %d) = %x, want %x", tc.id, tc.size, got, tc.want)
+			}
+			if len(got) != tc.size {
+				t.Errorf("otlpSpanID(%q, %d) returned %d bytes, want %d", tc.id, tc.size, len(got), tc.size)
+			}
+		})
+	}
+}
@@ -5,80 +5,437 @@ import (
 	"context"
 	"crypto/tls"
 	"fmt"
+	"math/rand"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/newrelic/go-agent/v3/internal"
 	v1 "github.com/newrelic/go-agent/v3/internal/com_newrelic_trace_v1"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
 	"google.golang.org/grpc/metadata"
 )
 
 type traceBox struct {
 	messages chan *internal.SpanEvent
+	spilled  chan *v1.Span
+	config   TraceBoxConfig
+	spill    *spillQueue
+	stats    traceBoxStats
+
+	// pending is the number of spans that have been accepted by
+	// ConsumeSpan (into messages, or spilled to disk) but not yet
+	// confirmed sent over the wire, nor permanently lost to spill
+	// eviction. Flush polls this to know when it's safe to return.
+	pending int64
+
+	// ctx governs the lifetime of the reconnect loop and its active
+	// connection; cancel is called exactly once, by Shutdown. done is
+	// closed once the reconnect loop has returned.
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// endpoints is the list of ingest endpoints the sender fails over
+	// across. It holds a single entry unless TraceBoxConfig.Endpoints was
+	// set. epIdx, taken modulo len(endpoints), selects the endpoint the
+	// reconnect loop will try next; it's incremented whenever
+	// spawnConnection reports that the current endpoint should be rotated
+	// away from.
+	endpoints []string
+	epIdx     int32
+	epStats   []traceBoxEndpointCounters
+
+	// activeEndpoint and lastHealth are read by TraceBoxStats and written
+	// by spawnConnection and its health-check goroutine.
+	activeEndpoint atomic.Value // string
+	lastHealth     atomic.Value // string
+}
+
+// traceBoxEndpointCounters holds the per-endpoint success/failure counts
+// backing TraceBoxEndpointStats. Fields are accessed atomically since they
+// are updated from the sender and health-check goroutines and read from
+// arbitrary application goroutines via TraceBoxStats.
+type traceBoxEndpointCounters struct {
+	successes int64
+	failures  int64
 }
 
 const (
 	apiKeyMetadataKey        = "api_key"
 	traceboxMessageQueueSize = 1000
+
+	// defaultTraceBoxBatchSize is the number of spans gathered into a
+	// single outgoing send when TraceBoxConfig.BatchSize is unset.
+	defaultTraceBoxBatchSize = 100
+
+	// defaultTraceBoxBatchTimeout is the maximum time a partial batch is
+	// held before being flushed when TraceBoxConfig.BatchTimeout is unset.
+	defaultTraceBoxBatchTimeout = 50 * time.Millisecond
+
+	// defaultTraceBoxConnectTimeout bounds how long a single dial attempt
+	// is given to complete when TraceBoxConfig.ConnectTimeout is unset.
+	defaultTraceBoxConnectTimeout = 10 * time.Second
+
+	// defaultTraceBoxKeepaliveTime and defaultTraceBoxKeepaliveTimeout
+	// configure the gRPC keepalive pings used when the corresponding
+	// TraceBoxConfig fields are unset.
+	defaultTraceBoxKeepaliveTime    = 30 * time.Second
+	defaultTraceBoxKeepaliveTimeout = 10 * time.Second
+
+	// traceBoxBackoffBase and traceBoxBackoffMax bound the jittered
+	// exponential backoff used between reconnect attempts.
+	traceBoxBackoffBase = 1 * time.Second
+	traceBoxBackoffMax  = 300 * time.Second
+
+	// traceBoxDrainTimeout bounds how long spawnConnection waits to pull
+	// one last batch out of the queues before closing, once asked to
+	// stop.
+	traceBoxDrainTimeout = 2 * time.Second
+
+	// traceBoxFlushTimeout bounds how long Flush waits for the queues to
+	// empty out.
+	traceBoxFlushTimeout = 5 * time.Second
+
+	// defaultTraceBoxHealthCheckInterval and
+	// defaultTraceBoxHealthCheckTimeout configure how often spawnConnection
+	// probes the ingest service's health endpoint, and how long each probe
+	// is given to complete, when the corresponding TraceBoxConfig fields
+	// are unset.
+	defaultTraceBoxHealthCheckInterval = 30 * time.Second
+	defaultTraceBoxHealthCheckTimeout  = 5 * time.Second
 )
 
-var (
-	traceBoxBackoffStrategy = []time.Duration{
-		15 * time.Second,
-		15 * time.Second,
-		30 * time.Second,
-		60 * time.Second,
-		120 * time.Second,
-		300 * time.Second,
+// traceBoxBackoff returns a jittered exponential backoff for the given
+// reconnect attempt, doubling from traceBoxBackoffBase up to
+// traceBoxBackoffMax. attempts is reset to zero whenever a connection
+// succeeds, so a single flaky dial doesn't push later attempts into the
+// long end of the range.
+func traceBoxBackoff(attempt int) time.Duration {
+	backoff := traceBoxBackoffMax
+	if attempt < 32 { // avoid overflowing the shift
+		if scaled := traceBoxBackoffBase << uint(attempt); scaled > 0 && scaled < traceBoxBackoffMax {
+			backoff = scaled
+		}
 	}
-)
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2+1)))
+}
+
+// TraceBoxConfig controls how spans are batched on their way to the trace
+// observer endpoint, and how the sender spills to disk when the in-memory
+// queue can't keep up.
+//
+// TODO(tiaanl/go-agent#chunk0-1): expose this as a field on newrelic.Config
+// once that type exists in this package, so it's reachable from normal
+// application setup instead of only by constructing a traceBox directly.
+type TraceBoxConfig struct {
+	// BatchSize is the maximum number of spans gathered into a single
+	// outgoing send. Defaults to 100 if zero.
+	BatchSize int
+
+	// BatchTimeout is the maximum amount of time a partial batch is held
+	// before being flushed, even if BatchSize has not been reached.
+	// Defaults to 50ms if zero.
+	BatchTimeout time.Duration
+
+	// SpillDir, if non-empty, enables disk-backed spillover: spans that
+	// cannot be buffered in memory are appended to rotating files in
+	// this directory instead of being dropped.
+	SpillDir string
+
+	// SpillMaxBytes is the maximum total size, in bytes, of spill files
+	// retained on disk. Once exceeded, the oldest spill files are
+	// removed to make room for new ones. Defaults to 64MB if zero.
+	SpillMaxBytes int64
+
+	// ConnectTimeout bounds how long a single dial attempt is given to
+	// complete before it's treated as a failure. Defaults to 10s if
+	// zero.
+	ConnectTimeout time.Duration
+
+	// KeepaliveTime and KeepaliveTimeout configure the gRPC keepalive
+	// pings sent on an otherwise idle connection. Default to 30s and 10s
+	// respectively if zero.
+	KeepaliveTime    time.Duration
+	KeepaliveTimeout time.Duration
+
+	// Endpoints, if non-empty, is the ordered list of ingest endpoints the
+	// sender fails over across: on a health check failure or stream
+	// error, it rotates to the next endpoint in the list, wrapping back
+	// to the first. If empty, the single endpoint passed to newTraceBox
+	// is used and no failover is possible.
+	Endpoints []string
+
+	// HealthCheckInterval is how often the sender issues a gRPC health
+	// Check RPC against the active endpoint's ingest service. Defaults to
+	// 30s if zero.
+	HealthCheckInterval time.Duration
+
+	// HealthCheckTimeout bounds how long a single health Check RPC is
+	// given to complete before it's treated as a failure. Defaults to 5s
+	// if zero.
+	HealthCheckTimeout time.Duration
+}
+
+func (c TraceBoxConfig) batchSize() int {
+	if c.BatchSize <= 0 {
+		return defaultTraceBoxBatchSize
+	}
+	return c.BatchSize
+}
+
+func (c TraceBoxConfig) batchTimeout() time.Duration {
+	if c.BatchTimeout <= 0 {
+		return defaultTraceBoxBatchTimeout
+	}
+	return c.BatchTimeout
+}
+
+func (c TraceBoxConfig) connectTimeout() time.Duration {
+	if c.ConnectTimeout <= 0 {
+		return defaultTraceBoxConnectTimeout
+	}
+	return c.ConnectTimeout
+}
+
+func (c TraceBoxConfig) keepaliveTime() time.Duration {
+	if c.KeepaliveTime <= 0 {
+		return defaultTraceBoxKeepaliveTime
+	}
+	return c.KeepaliveTime
+}
 
-func getTraceBoxBackoff(attempt int) time.Duration {
-	if attempt < len(traceBoxBackoffStrategy) {
-		return traceBoxBackoffStrategy[attempt]
+func (c TraceBoxConfig) keepaliveTimeout() time.Duration {
+	if c.KeepaliveTimeout <= 0 {
+		return defaultTraceBoxKeepaliveTimeout
 	}
-	return traceBoxBackoffStrategy[len(traceBoxBackoffStrategy)-1]
+	return c.KeepaliveTimeout
 }
 
-func newTraceBox(endpoint, apiKey string, lg Logger) (*traceBox, error) {
+func (c TraceBoxConfig) healthCheckInterval() time.Duration {
+	if c.HealthCheckInterval <= 0 {
+		return defaultTraceBoxHealthCheckInterval
+	}
+	return c.HealthCheckInterval
+}
+
+func (c TraceBoxConfig) healthCheckTimeout() time.Duration {
+	if c.HealthCheckTimeout <= 0 {
+		return defaultTraceBoxHealthCheckTimeout
+	}
+	return c.HealthCheckTimeout
+}
+
+// traceBoxStats holds the counters backing TraceBoxStats. All fields are
+// accessed atomically since they are updated from the sender goroutine and
+// read from arbitrary application goroutines.
+type traceBoxStats struct {
+	dropped int64
+	spilled int64
+	batched int64
+}
+
+// TraceBoxStatsSnapshot is a point-in-time copy of a traceBox's counters, as
+// returned by traceBox.TraceBoxStats.
+type TraceBoxStatsSnapshot struct {
+	// Dropped is the number of spans discarded because the in-memory
+	// queue was full and no spill directory was configured (or the spill
+	// write itself failed).
+	Dropped int64
+
+	// Spilled is the number of spans written to disk because the
+	// in-memory queue was full.
+	Spilled int64
+
+	// Batched is the number of spans that were successfully sent to the
+	// trace observer.
+	Batched int64
+
+	// ActiveEndpoint is the ingest endpoint the sender is currently
+	// connected to, or was last connected to.
+	ActiveEndpoint string
+
+	// LastHealthStatus is the outcome of the most recent health Check RPC
+	// against ActiveEndpoint: "healthy", "unhealthy", or "unknown" if no
+	// health check has completed yet.
+	LastHealthStatus string
+
+	// Endpoints holds per-endpoint success/failure counts, in the same
+	// order as TraceBoxConfig.Endpoints, for diagnosing which ingest
+	// endpoints are flaky.
+	Endpoints []TraceBoxEndpointStats
+}
+
+// TraceBoxEndpointStats is a point-in-time copy of one endpoint's
+// success/failure counters, as returned as part of TraceBoxStatsSnapshot.
+type TraceBoxEndpointStats struct {
+	// Endpoint is the ingest endpoint these counters apply to.
+	Endpoint string
+
+	// Successes is the number of times this endpoint was dialed or health
+	// checked successfully.
+	Successes int64
+
+	// Failures is the number of times a dial, stream, or health check
+	// against this endpoint failed.
+	Failures int64
+}
+
+// TraceBoxStats returns a snapshot of this traceBox's batching, spillover,
+// and endpoint health counters, for diagnostics and monitoring.
+func (tb *traceBox) TraceBoxStats() TraceBoxStatsSnapshot {
+	endpoints := make([]TraceBoxEndpointStats, len(tb.endpoints))
+	for i, ep := range tb.endpoints {
+		endpoints[i] = TraceBoxEndpointStats{
+			Endpoint:  ep,
+			Successes: atomic.LoadInt64(&tb.epStats[i].successes),
+			Failures:  atomic.LoadInt64(&tb.epStats[i].failures),
+		}
+	}
+
+	activeEndpoint, _ := tb.activeEndpoint.Load().(string)
+	lastHealth, _ := tb.lastHealth.Load().(string)
+
+	return TraceBoxStatsSnapshot{
+		Dropped:          atomic.LoadInt64(&tb.stats.dropped),
+		Spilled:          atomic.LoadInt64(&tb.stats.spilled),
+		Batched:          atomic.LoadInt64(&tb.stats.batched),
+		ActiveEndpoint:   activeEndpoint,
+		LastHealthStatus: lastHealth,
+		Endpoints:        endpoints,
+	}
+}
+
+func newTraceBox(endpoint, apiKey string, lg Logger, config TraceBoxConfig) (*traceBox, error) {
 	messages := make(chan *internal.SpanEvent, traceboxMessageQueueSize)
 
+	var spill *spillQueue
+	if "" != config.SpillDir {
+		var err error
+		spill, err = newSpillQueue(config.SpillDir, config.SpillMaxBytes)
+		if nil != err {
+			return nil, fmt.Errorf("unable to create trace box spill queue: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	endpoints := config.Endpoints
+	if 0 == len(endpoints) {
+		endpoints = []string{endpoint}
+	}
+
+	tb := &traceBox{
+		messages:  messages,
+		spilled:   make(chan *v1.Span, traceboxMessageQueueSize),
+		config:    config,
+		spill:     spill,
+		ctx:       ctx,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+		endpoints: endpoints,
+		epStats:   make([]traceBoxEndpointCounters, len(endpoints)),
+	}
+	tb.activeEndpoint.Store("")
+	tb.lastHealth.Store("unknown")
+
+	if nil != spill {
+		spill.onEvict = func(spans int64) {
+			atomic.AddInt64(&tb.pending, -spans)
+		}
+	}
+
 	go func() {
+		defer close(tb.done)
+
 		attempts := 0
 		for {
-			err := spawnConnection(endpoint, apiKey, lg, messages)
+			select {
+			case <-tb.ctx.Done():
+				return
+			default:
+			}
+
+			epIdx := int(atomic.LoadInt32(&tb.epIdx)) % len(tb.endpoints)
+			connected, rotate, err := spawnConnection(tb.endpoints[epIdx], apiKey, lg, tb, epIdx)
 			if nil != err {
-				// TODO: Maybe decide if a reconnect should be
-				// tried.
-				fmt.Println(err)
+				lg.Error("trace box connection error", map[string]interface{}{
+					"endpoint": tb.endpoints[epIdx],
+					"err":      err.Error(),
+				})
 			}
-			time.Sleep(getTraceBoxBackoff(attempts))
-			attempts++
+			if connected {
+				attempts = 0
+			} else {
+				attempts++
+			}
+			atomic.StoreInt32(&tb.epIdx, nextEndpointIndex(atomic.LoadInt32(&tb.epIdx), len(tb.endpoints), rotate))
 
+			select {
+			case <-tb.ctx.Done():
+				return
+			case <-time.After(traceBoxBackoff(attempts)):
+			}
 		}
 	}()
 
-	return &traceBox{messages: messages}, nil
+	if nil != spill {
+		go spill.drain(tb)
+	}
+
+	return tb, nil
 }
 
-func spawnConnection(endpoint, apiKey string, lg Logger, messages <-chan *internal.SpanEvent) error {
+// spawnConnection dials endpoint, streams spans until the connection is
+// interrupted, a health check fails, or tb.ctx is cancelled, and reports
+// whether it ever reached a usable connection (used by the caller to decide
+// whether to reset its backoff) and whether the caller should rotate to the
+// next endpoint in tb.endpoints before reconnecting.
+func spawnConnection(endpoint, apiKey string, lg Logger, tb *traceBox, epIdx int) (connected bool, rotate bool, err error) {
+	connCtx, connCancel := context.WithCancel(tb.ctx)
+	defer connCancel()
 
-	responseError := make(chan error, 1)
+	dialCtx, dialCancel := context.WithTimeout(connCtx, tb.config.connectTimeout())
+	defer dialCancel()
 
-	conn, err := grpc.Dial(endpoint, grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{})))
+	conn, err := grpc.DialContext(dialCtx, endpoint,
+		grpc.WithBlock(),
+		grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{})),
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                tb.config.keepaliveTime(),
+			Timeout:             tb.config.keepaliveTimeout(),
+			PermitWithoutStream: true,
+		}),
+	)
 	if nil != err {
-		return fmt.Errorf("unable to dial grpc endpoint %s: %v", endpoint, err)
+		tb.recordEndpointResult(epIdx, false)
+		return false, true, fmt.Errorf("unable to dial grpc endpoint %s: %v", endpoint, err)
 	}
+	defer conn.Close()
+
+	tb.activeEndpoint.Store(endpoint)
+	tb.lastHealth.Store("unknown")
+	tb.recordEndpointResult(epIdx, true)
 
 	serviceClient := v1.NewIngestServiceClient(conn)
 
-	spanClient, err := serviceClient.RecordSpan(metadata.AppendToOutgoingContext(context.Background(), "api_key", apiKey))
+	// The stream gets its own context rather than connCtx, so that it's
+	// still usable for the final batch sent after tb.ctx is cancelled.
+	streamCtx, streamCancel := context.WithCancel(context.Background())
+	defer streamCancel()
+
+	spanClient, err := serviceClient.RecordSpan(metadata.AppendToOutgoingContext(streamCtx, "api_key", apiKey))
 	if nil != err {
-		return fmt.Errorf("unable to create span client: %v", err)
+		tb.recordEndpointResult(epIdx, false)
+		return false, true, fmt.Errorf("unable to create span client: %v", err)
 	}
 
+	go tb.monitorEndpointHealth(connCtx, connCancel, conn, epIdx, lg)
+
+	responseError := make(chan error, 1)
 	go func() {
 		for {
 			status, err := spanClient.Recv()
@@ -95,41 +452,180 @@ func spawnConnection(endpoint, apiKey string, lg Logger, messages <-chan *intern
 		}
 	}()
 
+	batchSize := tb.config.batchSize()
+	batchTimeout := tb.config.batchTimeout()
+	batch := make([]*v1.Span, 0, batchSize)
+
+	timer := time.NewTimer(batchTimeout)
+	defer timer.Stop()
+
+	flush := func() error {
+		if 0 == len(batch) {
+			return nil
+		}
+		for _, span := range batch {
+			lg.Debug("sending span to trace box", map[string]interface{}{
+				"name": span.Intrinsics["name"].GetStringValue(),
+			})
+			if err := spanClient.Send(span); nil != err {
+				return err
+			}
+			atomic.AddInt64(&tb.stats.batched, 1)
+			atomic.AddInt64(&tb.pending, -1)
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+sendLoop:
 	for {
 		var err error
-		var event *internal.SpanEvent
+		var span *v1.Span
+
 		select {
+		case <-connCtx.Done():
+			if connCtxCancelledBySelf(tb.ctx) {
+				rotate = true
+				tb.recordEndpointResult(epIdx, false)
+			}
+			break sendLoop
 		case err = <-responseError:
-		case event = <-messages:
+		case event := <-tb.messages:
+			span = transformEvent(event)
+		case span = <-tb.spilled:
+		case <-timer.C:
+			if err := flush(); nil != err {
+				lg.Debug("trace box sender send error", map[string]interface{}{
+					"err": err.Error(),
+				})
+				rotate = true
+				tb.recordEndpointResult(epIdx, false)
+				break sendLoop
+			}
+			timer.Reset(batchTimeout)
+			continue
 		}
 		if nil != err {
 			lg.Debug("trace box sender received response error", map[string]interface{}{
 				"err": err.Error(),
 			})
-			break
+			rotate = true
+			tb.recordEndpointResult(epIdx, false)
+			break sendLoop
 		}
-		span := transformEvent(event)
-		lg.Debug("sending span to trace box", map[string]interface{}{
-			"name": event.Name,
-		})
-		err = spanClient.Send(span)
-		if nil != err {
-			lg.Debug("trace box sender send error", map[string]interface{}{
-				"err": err.Error(),
-			})
-			break
+
+		batch = append(batch, span)
+		if len(batch) >= batchSize {
+			if err := flush(); nil != err {
+				lg.Debug("trace box sender send error", map[string]interface{}{
+					"err": err.Error(),
+				})
+				rotate = true
+				tb.recordEndpointResult(epIdx, false)
+				break sendLoop
+			}
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(batchTimeout)
 		}
 	}
 
+	// On the way out, give whatever is still queued a bounded chance to
+	// go out in a final batch rather than being silently lost.
+	drainDeadline := time.After(traceBoxDrainTimeout)
+drainLoop:
+	for len(batch) < batchSize {
+		select {
+		case event := <-tb.messages:
+			batch = append(batch, transformEvent(event))
+		case span := <-tb.spilled:
+			batch = append(batch, span)
+		case <-drainDeadline:
+			break drainLoop
+		}
+	}
+	if err := flush(); nil != err {
+		lg.Debug("trace box final flush error", map[string]interface{}{
+			"err": err.Error(),
+		})
+	}
+
 	lg.Debug("closing trace box sender", map[string]interface{}{})
-	err = spanClient.CloseSend()
-	if nil != err {
+	if err := spanClient.CloseSend(); nil != err {
 		lg.Debug("error closing trace box sender", map[string]interface{}{
 			"err": err.Error(),
 		})
 	}
 
-	return nil
+	return true, rotate, nil
+}
+
+// nextEndpointIndex returns the endpoint index the reconnect loop should try
+// next. It only advances past idx when rotate is requested and there is more
+// than one endpoint to fail over to; with a single endpoint there's nothing
+// to rotate to, so the loop just keeps retrying it.
+func nextEndpointIndex(idx int32, numEndpoints int, rotate bool) int32 {
+	if rotate && 1 < numEndpoints {
+		return idx + 1
+	}
+	return idx
+}
+
+// connCtxCancelledBySelf reports whether connCtx (passed as its governing
+// tbCtx, i.e. tb.ctx) must have been cancelled on its own, e.g. by the
+// health-check goroutine calling connCancel, rather than by tb.ctx being
+// cancelled via Shutdown. spawnConnection uses this to decide whether a
+// connCtx.Done() wakeup is a failure that should trigger rotation and a
+// recorded endpoint failure, or a graceful shutdown that shouldn't.
+func connCtxCancelledBySelf(tbCtx context.Context) bool {
+	return nil == tbCtx.Err()
+}
+
+// recordEndpointResult updates the success/failure counters for the
+// endpoint at tb.endpoints[idx].
+func (tb *traceBox) recordEndpointResult(idx int, success bool) {
+	if success {
+		atomic.AddInt64(&tb.epStats[idx].successes, 1)
+	} else {
+		atomic.AddInt64(&tb.epStats[idx].failures, 1)
+	}
+}
+
+// monitorEndpointHealth periodically issues gRPC health Check RPCs against
+// conn for as long as connCtx is open, recording the outcome against
+// tb.endpoints[epIdx] and exposing it through tb.lastHealth. On the first
+// failed check it calls connCancel to tear down the connection so the
+// sender reconnects and, per spawnConnection's sendLoop, rotates to the
+// next endpoint.
+func (tb *traceBox) monitorEndpointHealth(connCtx context.Context, connCancel context.CancelFunc, conn *grpc.ClientConn, epIdx int, lg Logger) {
+	client := grpc_health_v1.NewHealthClient(conn)
+	ticker := time.NewTicker(tb.config.healthCheckInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-connCtx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		checkCtx, checkCancel := context.WithTimeout(connCtx, tb.config.healthCheckTimeout())
+		resp, err := client.Check(checkCtx, &grpc_health_v1.HealthCheckRequest{})
+		checkCancel()
+
+		if nil != err || grpc_health_v1.HealthCheckResponse_SERVING != resp.GetStatus() {
+			tb.lastHealth.Store("unhealthy")
+			lg.Debug("trace box health check failed", map[string]interface{}{
+				"endpoint": tb.endpoints[epIdx],
+			})
+			connCancel()
+			return
+		}
+
+		tb.lastHealth.Store("healthy")
+		tb.recordEndpointResult(epIdx, true)
+	}
 }
 
 func mtbString(s string) *v1.AttributeValue {
@@ -186,34 +682,68 @@ func transformEvent(e *internal.SpanEvent) *v1.Span {
 	}
 
 	for key, val := range e.Attributes {
-		// This assumes all values are string types.
-		// TODO: Future-proof this!
-		b := bytes.Buffer{}
-		val.WriteJSON(&b)
-		s := strings.Trim(b.String(), `"`)
-		span.AgentAttributes[key.String()] = mtbString(s)
+		span.AgentAttributes[key.String()] = mtbAttributeValue(val)
 	}
 
 	return span
 }
 
-// func (tb *traceBox) sendSpans(events []*internal.SpanEvent) {
-// 	for _, e := range events {
-// 		span := transformEvent(e)
-// 		fmt.Println("sending span", e.Name)
-// 		err := tb.spanClient.Send(span)
-// 		if nil != err {
-// 			// TODO: Deal with this.
-// 			fmt.Println("spanClient.Send error", err.Error())
-// 		}
-// 	}
-// }
+// spanAttributeValuer is implemented by internal.SpanEvent attribute values
+// that expose their original Go type, in addition to the JSON rendering used
+// for the rest of the agent's attribute reporting. This lets transformEvent
+// preserve type fidelity when it's available, while still falling back to
+// the stringified form for attribute values that don't.
+type spanAttributeValuer interface {
+	Value() interface{}
+}
+
+// jsonWriter is implemented by every internal.SpanEvent attribute value,
+// string-typed or not, so transformEvent always has a fallback rendering.
+type jsonWriter interface {
+	WriteJSON(buf *bytes.Buffer)
+}
 
-func (tb *traceBox) consumeSpan(span *internal.SpanEvent) bool {
+// mtbAttributeValue converts a span attribute into its typed AttributeValue
+// representation when possible, dispatching on the attribute's original Go
+// type rather than forcing everything through AttributeValue_StringValue.
+func mtbAttributeValue(val jsonWriter) *v1.AttributeValue {
+	if valuer, ok := val.(spanAttributeValuer); ok {
+		switch v := valuer.Value().(type) {
+		case bool:
+			return mtbBool(v)
+		case int64:
+			return mtbInt(v)
+		case float64:
+			return mtbDouble(v)
+		case string:
+			return mtbString(v)
+		}
+	}
+
+	b := bytes.Buffer{}
+	val.WriteJSON(&b)
+	return mtbString(strings.Trim(b.String(), `"`))
+}
+
+// ConsumeSpan offers span to the in-memory send queue. If the queue is full
+// and disk spillover is configured, span is appended to the spill queue
+// instead of being dropped. ConsumeSpan implements SpanExporter.
+func (tb *traceBox) ConsumeSpan(span *internal.SpanEvent) bool {
 	select {
 	case tb.messages <- span:
+		atomic.AddInt64(&tb.pending, 1)
 		return true
 	default:
-		return false
 	}
+
+	if nil != tb.spill {
+		if err := tb.spill.write(transformEvent(span)); nil == err {
+			atomic.AddInt64(&tb.stats.spilled, 1)
+			atomic.AddInt64(&tb.pending, 1)
+			return true
+		}
+	}
+
+	atomic.AddInt64(&tb.stats.dropped, 1)
+	return false
 }
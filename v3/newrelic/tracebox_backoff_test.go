@@ -0,0 +1,35 @@
+package newrelic
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTraceBoxBackoffBounds(t *testing.T) {
+	testcases := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{0, traceBoxBackoffBase},
+		{1, 2 * traceBoxBackoffBase},
+		{4, 16 * traceBoxBackoffBase},
+	}
+
+	for _, tc := range testcases {
+		for i := 0; i < 20; i++ {
+			got := traceBoxBackoff(tc.attempt)
+			if got < 0 || got > tc.max {
+				t.Fatalf("traceBoxBackoff(%d) = %v, want within [0, %v]", tc.attempt, got, tc.max)
+			}
+		}
+	}
+}
+
+func TestTraceBoxBackoffCapsAtMax(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		got := traceBoxBackoff(40)
+		if got > traceBoxBackoffMax {
+			t.Fatalf("traceBoxBackoff(40) = %v, want <= %v", got, traceBoxBackoffMax)
+		}
+	}
+}
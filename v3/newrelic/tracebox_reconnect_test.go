@@ -0,0 +1,47 @@
+package newrelic
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNextEndpointIndexOnlyRotatesWithMoreThanOneEndpoint(t *testing.T) {
+	testcases := []struct {
+		name         string
+		idx          int32
+		numEndpoints int
+		rotate       bool
+		want         int32
+	}{
+		{"no rotation requested, single endpoint", 0, 1, false, 0},
+		{"no rotation requested, multiple endpoints", 0, 3, false, 0},
+		{"rotation requested, single endpoint is a no-op", 0, 1, true, 0},
+		{"rotation requested, multiple endpoints advances", 0, 3, true, 1},
+		{"rotation requested, advances from a non-zero index", 1, 3, true, 2},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := nextEndpointIndex(tc.idx, tc.numEndpoints, tc.rotate); got != tc.want {
+				t.Errorf("nextEndpointIndex(%d, %d, %v) = %d, want %d", tc.idx, tc.numEndpoints, tc.rotate, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestConnCtxCancelledBySelfDistinguishesFromShutdown(t *testing.T) {
+	t.Run("tb.ctx still open means connCtx was cancelled on its own", func(t *testing.T) {
+		tbCtx := context.Background()
+		if !connCtxCancelledBySelf(tbCtx) {
+			t.Error("connCtxCancelledBySelf = false, want true when tb.ctx is not done")
+		}
+	})
+
+	t.Run("tb.ctx cancelled means it was Shutdown, not a self-cancel", func(t *testing.T) {
+		tbCtx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if connCtxCancelledBySelf(tbCtx) {
+			t.Error("connCtxCancelledBySelf = true, want false when tb.ctx is done")
+		}
+	})
+}
@@ -0,0 +1,267 @@
+package newrelic
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "github.com/newrelic/go-agent/v3/internal/com_newrelic_trace_v1"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// defaultSpillMaxBytes is used when TraceBoxConfig.SpillMaxBytes is
+	// unset.
+	defaultSpillMaxBytes = 64 * 1024 * 1024
+
+	// spillFileMaxBytes is the size at which a spill file is rotated.
+	spillFileMaxBytes = 4 * 1024 * 1024
+
+	// spillFilePrefix names the rotating files written under SpillDir.
+	spillFilePrefix = "tracebox-spill-"
+
+	// spillPollInterval is how often the drain loop checks for new spill
+	// files once it has caught up.
+	spillPollInterval = time.Second
+)
+
+// spillQueue is a directory of rotating files holding marshaled *v1.Span
+// records, used by traceBox as overflow storage when the in-memory send
+// queue is full.
+type spillQueue struct {
+	dir      string
+	maxBytes int64
+
+	// onEvict, if set, is called with the number of spans discarded
+	// whenever evictLocked removes a file to stay within maxBytes, so
+	// callers can keep their own pending-span accounting honest.
+	onEvict func(spans int64)
+
+	mu        sync.Mutex
+	curFile   *os.File
+	curSize   int64
+	totalSize int64
+	nextIndex int64
+	fileSpans map[string]int64
+}
+
+func newSpillQueue(dir string, maxBytes int64) (*spillQueue, error) {
+	if maxBytes <= 0 {
+		maxBytes = defaultSpillMaxBytes
+	}
+	if err := os.MkdirAll(dir, 0755); nil != err {
+		return nil, fmt.Errorf("unable to create spill dir %s: %v", dir, err)
+	}
+
+	q := &spillQueue{dir: dir, maxBytes: maxBytes, fileSpans: make(map[string]int64)}
+
+	existing, err := q.spillFiles()
+	if nil != err {
+		return nil, err
+	}
+	for _, name := range existing {
+		if info, err := os.Stat(name); nil == err {
+			q.totalSize += info.Size()
+		}
+	}
+
+	return q, nil
+}
+
+func (q *spillQueue) spillFiles() ([]string, error) {
+	entries, err := os.ReadDir(q.dir)
+	if nil != err {
+		return nil, fmt.Errorf("unable to read spill dir %s: %v", q.dir, err)
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasPrefix(e.Name(), spillFilePrefix) {
+			names = append(names, filepath.Join(q.dir, e.Name()))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// write appends span to the current spill file, rotating to a new file once
+// spillFileMaxBytes is exceeded, and evicting the oldest spill files once
+// the configured total size budget is exceeded.
+func (q *spillQueue) write(span *v1.Span) error {
+	data, err := proto.Marshal(span)
+	if nil != err {
+		return fmt.Errorf("unable to marshal span for spillover: %v", err)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if nil == q.curFile || q.curSize >= spillFileMaxBytes {
+		if err := q.rotateLocked(); nil != err {
+			return err
+		}
+	}
+
+	var lenBuf [4]byte
+	binary.BigEndian.PutUint32(lenBuf[:], uint32(len(data)))
+	if _, err := q.curFile.Write(lenBuf[:]); nil != err {
+		return err
+	}
+	if _, err := q.curFile.Write(data); nil != err {
+		return err
+	}
+
+	n := int64(len(lenBuf) + len(data))
+	q.curSize += n
+	q.totalSize += n
+	q.fileSpans[q.curFile.Name()]++
+
+	return q.evictLocked()
+}
+
+func (q *spillQueue) rotateLocked() error {
+	if nil != q.curFile {
+		q.curFile.Close()
+	}
+	name := filepath.Join(q.dir, fmt.Sprintf("%s%020d", spillFilePrefix, q.nextIndex))
+	q.nextIndex++
+	f, err := os.Create(name)
+	if nil != err {
+		return fmt.Errorf("unable to create spill file %s: %v", name, err)
+	}
+	q.curFile = f
+	q.curSize = 0
+	return nil
+}
+
+// evictLocked removes the oldest spill files until totalSize is within
+// maxBytes. Must be called with q.mu held.
+func (q *spillQueue) evictLocked() error {
+	if q.totalSize <= q.maxBytes {
+		return nil
+	}
+	names, err := q.spillFiles()
+	if nil != err {
+		return err
+	}
+	for _, name := range names {
+		if q.totalSize <= q.maxBytes {
+			break
+		}
+		if nil != q.curFile && name == q.curFile.Name() {
+			continue
+		}
+		info, err := os.Stat(name)
+		if nil != err {
+			continue
+		}
+		if err := os.Remove(name); nil != err {
+			continue
+		}
+		q.totalSize -= info.Size()
+
+		spans := q.fileSpans[name]
+		delete(q.fileSpans, name)
+		if nil != q.onEvict && 0 < spans {
+			q.onEvict(spans)
+		}
+	}
+	return nil
+}
+
+// currentFileName returns the name of the spill file currently being
+// written to, or "" if none has been opened yet. It takes q.mu so it can be
+// safely compared against from the drain goroutine while write/rotateLocked
+// mutate q.curFile from the sender goroutine.
+func (q *spillQueue) currentFileName() string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if nil == q.curFile {
+		return ""
+	}
+	return q.curFile.Name()
+}
+
+// drain reads spill files in order and feeds their spans into tb.spilled,
+// deleting each file once it has been fully consumed. It runs until
+// tb.ctx is done, polling for new spill files when the queue is empty, so
+// that it actually stops once traceBox.Shutdown cancels tb.ctx instead of
+// blocking forever on a send to tb.spilled that nothing will ever receive
+// again.
+func (q *spillQueue) drain(tb *traceBox) {
+	for {
+		select {
+		case <-tb.ctx.Done():
+			return
+		default:
+		}
+
+		names, err := q.spillFiles()
+		if nil != err || 0 == len(names) {
+			select {
+			case <-tb.ctx.Done():
+				return
+			case <-time.After(spillPollInterval):
+			}
+			continue
+		}
+
+		for _, name := range names {
+			if name == q.currentFileName() {
+				// Don't drain the file still being written to.
+				continue
+			}
+			if !q.drainFile(name, tb) {
+				return
+			}
+		}
+	}
+}
+
+// drainFile feeds the spans in name into tb.spilled and removes the file
+// once fully consumed. It returns false, leaving the file in place, if
+// tb.ctx is done before the file is fully drained.
+func (q *spillQueue) drainFile(name string, tb *traceBox) bool {
+	f, err := os.Open(name)
+	if nil != err {
+		return true
+	}
+	defer f.Close()
+
+	for {
+		var lenBuf [4]byte
+		if _, err := io.ReadFull(f, lenBuf[:]); nil != err {
+			break
+		}
+		size := binary.BigEndian.Uint32(lenBuf[:])
+		data := make([]byte, size)
+		if _, err := io.ReadFull(f, data); nil != err {
+			break
+		}
+		span := &v1.Span{}
+		if err := proto.Unmarshal(data, span); nil != err {
+			continue
+		}
+		select {
+		case tb.spilled <- span:
+		case <-tb.ctx.Done():
+			return false
+		}
+	}
+
+	info, err := f.Stat()
+	q.mu.Lock()
+	if nil == err {
+		q.totalSize -= info.Size()
+	}
+	delete(q.fileSpans, name)
+	q.mu.Unlock()
+
+	os.Remove(name)
+	return true
+}
@@ -0,0 +1,122 @@
+package newrelic
+
+import (
+	"context"
+	"testing"
+
+	v1 "github.com/newrelic/go-agent/v3/internal/com_newrelic_trace_v1"
+)
+
+func TestSpillQueueWriteRotateAndDrain(t *testing.T) {
+	q, err := newSpillQueue(t.TempDir(), 0)
+	if nil != err {
+		t.Fatalf("newSpillQueue: %v", err)
+	}
+
+	if err := q.write(&v1.Span{TraceId: "a"}); nil != err {
+		t.Fatalf("write: %v", err)
+	}
+	if err := q.rotateLocked(); nil != err {
+		t.Fatalf("rotateLocked: %v", err)
+	}
+	if err := q.write(&v1.Span{TraceId: "b"}); nil != err {
+		t.Fatalf("write: %v", err)
+	}
+
+	names, err := q.spillFiles()
+	if nil != err {
+		t.Fatalf("spillFiles: %v", err)
+	}
+	if want := 2; len(names) != want {
+		t.Fatalf("got %d spill files, want %d", len(names), want)
+	}
+	if got := q.fileSpans[names[0]]; 1 != got {
+		t.Errorf("file 0 has %d spans recorded, want 1", got)
+	}
+	if got := q.fileSpans[names[1]]; 1 != got {
+		t.Errorf("file 1 has %d spans recorded, want 1", got)
+	}
+
+	// Draining the non-current file should remove it and read back the
+	// span that was written to it.
+	tb := &traceBox{spilled: make(chan *v1.Span, 1), ctx: context.Background()}
+	if !q.drainFile(names[0], tb) {
+		t.Fatalf("drainFile returned false")
+	}
+	select {
+	case span := <-tb.spilled:
+		if "a" != span.TraceId {
+			t.Errorf("drained span TraceId = %q, want %q", span.TraceId, "a")
+		}
+	default:
+		t.Fatalf("drainFile did not feed the span into tb.spilled")
+	}
+	remaining, err := q.spillFiles()
+	if nil != err {
+		t.Fatalf("spillFiles: %v", err)
+	}
+	for _, name := range remaining {
+		if name == names[0] {
+			t.Errorf("drained file %s was not removed", names[0])
+		}
+	}
+	if _, ok := q.fileSpans[names[0]]; ok {
+		t.Errorf("fileSpans still tracks drained file %s", names[0])
+	}
+}
+
+func TestSpillQueueEvictsOldestFilesOverBudget(t *testing.T) {
+	q, err := newSpillQueue(t.TempDir(), 0)
+	if nil != err {
+		t.Fatalf("newSpillQueue: %v", err)
+	}
+
+	var evicted int64
+	q.onEvict = func(spans int64) { evicted += spans }
+
+	// Three separate files, one span each.
+	if err := q.write(&v1.Span{TraceId: "a"}); nil != err {
+		t.Fatalf("write: %v", err)
+	}
+	sizeAfterOne := q.totalSize
+	if err := q.rotateLocked(); nil != err {
+		t.Fatalf("rotateLocked: %v", err)
+	}
+	if err := q.write(&v1.Span{TraceId: "b"}); nil != err {
+		t.Fatalf("write: %v", err)
+	}
+	if err := q.rotateLocked(); nil != err {
+		t.Fatalf("rotateLocked: %v", err)
+	}
+	if err := q.write(&v1.Span{TraceId: "c"}); nil != err {
+		t.Fatalf("write: %v", err)
+	}
+
+	// Budget for roughly one file's worth: writing more should now evict
+	// the oldest file(s).
+	q.maxBytes = sizeAfterOne
+	if err := q.evictLocked(); nil != err {
+		t.Fatalf("evictLocked: %v", err)
+	}
+
+	names, err := q.spillFiles()
+	if nil != err {
+		t.Fatalf("spillFiles: %v", err)
+	}
+	if q.totalSize > q.maxBytes {
+		t.Errorf("totalSize %d exceeds maxBytes %d after eviction", q.totalSize, q.maxBytes)
+	}
+	if 0 == evicted {
+		t.Errorf("onEvict was never called despite exceeding the budget")
+	}
+	// The file currently being written to must never be evicted.
+	found := false
+	for _, name := range names {
+		if name == q.curFile.Name() {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("the active spill file was evicted")
+	}
+}
@@ -0,0 +1,69 @@
+package newrelic
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+)
+
+// Transaction is the unit of work the agent instruments. Only the
+// span-attribute plumbing needed by AddSpanAttribute is implemented here;
+// the rest of Transaction (segments, timing, request/response integration,
+// wiring to a running Application) isn't part of this package yet.
+//
+// TODO(tiaanl/go-agent#chunk0-2): once this package has a current-span/
+// segment model, have it drain spanAttrs into the internal.SpanEvent being
+// built for the active span (the same one transformEvent/transformEventToOTLP
+// already know how to forward with type fidelity), instead of just holding
+// them here.
+type Transaction struct {
+	mu        sync.Mutex
+	spanAttrs map[string]spanAttributeHolder
+}
+
+// spanAttributeHolder stores a span attribute's original Go type alongside
+// its JSON rendering, implementing the same duck-typed interfaces
+// (spanAttributeValuer, jsonWriter) that mtbAttributeValue and
+// otlpAttributeValue dispatch on, so a value added via AddSpanAttribute
+// survives with its original type intact end-to-end.
+type spanAttributeHolder struct {
+	value interface{}
+	json  string
+}
+
+func (h spanAttributeHolder) Value() interface{} { return h.value }
+
+func (h spanAttributeHolder) WriteJSON(buf *bytes.Buffer) {
+	buf.WriteString(h.json)
+}
+
+// AddSpanAttribute records a span-level attribute on txn. bool, int64,
+// float64, and string values are stored with their original type, in the
+// form mtbAttributeValue and otlpAttributeValue dispatch on; any other type
+// is stored as its fmt.Sprintf("%v", value) string form. The attributes are
+// held on txn only: nothing in this package copies them onto a span event
+// or hands them to an exporter.
+func (txn *Transaction) AddSpanAttribute(key string, value interface{}) {
+	holder := spanAttributeHolder{value: value}
+	switch v := value.(type) {
+	case bool:
+		holder.json = fmt.Sprintf("%t", v)
+	case int64:
+		holder.json = fmt.Sprintf("%d", v)
+	case float64:
+		holder.json = fmt.Sprintf("%v", v)
+	case string:
+		holder.json = fmt.Sprintf("%q", v)
+	default:
+		s := fmt.Sprintf("%v", v)
+		holder.value = s
+		holder.json = fmt.Sprintf("%q", s)
+	}
+
+	txn.mu.Lock()
+	defer txn.mu.Unlock()
+	if nil == txn.spanAttrs {
+		txn.spanAttrs = make(map[string]spanAttributeHolder)
+	}
+	txn.spanAttrs[key] = holder
+}
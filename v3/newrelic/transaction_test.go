@@ -0,0 +1,53 @@
+package newrelic
+
+import "testing"
+
+func TestAddSpanAttributePreservesType(t *testing.T) {
+	testcases := []struct {
+		name      string
+		value     interface{}
+		wantValue interface{}
+		wantJSON  string
+	}{
+		{"bool", true, true, "true"},
+		{"int64", int64(7), int64(7), "7"},
+		{"float64", 3.5, 3.5, "3.5"},
+		{"string", "hi", "hi", `"hi"`},
+		{"unsupported type falls back to its string form", 7, "7", `"7"`},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			txn := &Transaction{}
+			txn.AddSpanAttribute("key", tc.value)
+
+			got, ok := txn.spanAttrs["key"]
+			if !ok {
+				t.Fatalf("AddSpanAttribute did not record %q", "key")
+			}
+			if got.Value() != tc.wantValue {
+				t.Errorf("Value() = %#v, want %#v", got.Value(), tc.wantValue)
+			}
+			if got := mtbAttributeValue(got).String(); got != mtbAttributeValue(fakeAttributeValue{value: tc.wantValue, json: tc.wantJSON}).String() {
+				t.Errorf("mtbAttributeValue mismatch for %v: got %v", tc.value, got)
+			}
+		})
+	}
+}
+
+func TestAddSpanAttributeIsSafeForConcurrentUse(t *testing.T) {
+	txn := &Transaction{}
+	done := make(chan struct{})
+	for i := 0; i < 10; i++ {
+		go func(i int) {
+			txn.AddSpanAttribute("key", i)
+			done <- struct{}{}
+		}(i)
+	}
+	for i := 0; i < 10; i++ {
+		<-done
+	}
+	if _, ok := txn.spanAttrs["key"]; !ok {
+		t.Error("AddSpanAttribute did not record the attribute under concurrent use")
+	}
+}